@@ -0,0 +1,281 @@
+package wikibrief
+
+import (
+	"container/list"
+	"context"
+	"os"
+	"sync"
+
+	errorsOnSteroids "github.com/pkg/errors"
+)
+
+//CacheOptions tunes the memory budget of the revision cache New places in front of
+//each page's revision channel. The zero value disables the budget, so the cache
+//degrades to a plain pass-through and buffer sizing falls back to the historical
+//fixed-size buffers.
+type CacheOptions struct {
+	//MaxTotalBytes caps the cumulative size of revision Text payloads buffered across
+	//every page produced by a single New call. Zero leaves the cap unset.
+	MaxTotalBytes int64
+	//MaxPageBytes caps the size of revision Text payloads buffered for a single page.
+	//Zero derives it from MaxTotalBytes.
+	MaxPageBytes int64
+	//MemoryFraction, when in (0, 1], overrides MaxTotalBytes with that fraction of the
+	//system memory reported by /proc/meminfo (or runtime.MemStats if unavailable),
+	//mirroring Hugo's HUGO_MEMORYLIMIT knob.
+	MemoryFraction float64
+}
+
+//CacheStats is a point-in-time snapshot of a Cache's bookkeeping.
+type CacheStats struct {
+	BytesInUse int64
+	Evictions  uint64
+	Hits       uint64
+}
+
+//Cache tracks the in-flight bytes of buffered revision Text payloads and spills the
+//coldest ones to a file under tmpDir once CacheOptions' budget is exceeded,
+//rehydrating them right before they are delivered to the consumer.
+type Cache struct {
+	opts      CacheOptions
+	spillFile *os.File
+
+	mu        sync.Mutex
+	used      int64
+	offset    int64
+	evictions uint64
+	hits      uint64
+}
+
+//newCache creates a Cache spilling to a temporary file under tmpDir. The returned
+//Cache must be closed once every page it serves has been fully drained.
+func newCache(tmpDir string, opts CacheOptions) (c *Cache, err error) {
+	opts = resolveCacheOptions(opts)
+
+	if opts.MaxTotalBytes <= 0 { //no budget configured: spool degrades to a pass-through, so skip the spill file entirely
+		return &Cache{opts: opts}, nil
+	}
+
+	f, err := os.CreateTemp(tmpDir, "wikibrief-cache-*.spill")
+	if err != nil {
+		return nil, errorsOnSteroids.Wrapf(err, "Error while creating cache spill file in %q", tmpDir)
+	}
+
+	return &Cache{opts: opts, spillFile: f}, nil
+}
+
+//Stats returns a snapshot of the cache's bookkeeping.
+func (c *Cache) Stats() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return CacheStats{BytesInUse: c.used, Evictions: c.evictions, Hits: c.hits}
+}
+
+//Close releases the cache's spill file. It is a no-op on a nil or already-closed Cache.
+func (c *Cache) Close() error {
+	if c == nil || c.spillFile == nil {
+		return nil
+	}
+
+	name := c.spillFile.Name()
+	err := c.spillFile.Close()
+	os.Remove(name)
+	c.spillFile = nil
+	return err
+}
+
+//queuedRevision is a Revision waiting in a spool, possibly with its Text evicted to disk.
+type queuedRevision struct {
+	rev          Revision
+	spilled      bool
+	offset, size int64
+}
+
+//spool copies in to the returned channel, spilling the Text of the coldest pending
+//revisions to disk whenever the cache is over the global or this page's own MaxPageBytes
+//budget and rehydrating it right before delivery. With no budget configured it is a
+//transparent pass-through.
+func (c *Cache) spool(ctx context.Context, in <-chan Revision) <-chan Revision {
+	if c == nil || c.opts.MaxTotalBytes <= 0 {
+		return in
+	}
+
+	out := make(chan Revision, cap(in))
+	go func() {
+		defer close(out)
+
+		pending := list.New()
+		var pageUsed int64
+		enqueue := func(r Revision) {
+			pending.PushBack(&queuedRevision{rev: r})
+			pageUsed += int64(len(r.Text))
+			c.track(int64(len(r.Text)))
+			pageUsed = c.evictCold(pending, pageUsed)
+		}
+
+		for in != nil || pending.Len() > 0 {
+			front := frontOf(pending)
+
+			//Only offer the front of the queue for delivery this round if it is already
+			//in memory: rehydrating a spilled revision means reading it back off disk, so
+			//that must happen only once we are committed to actually sending it - see below.
+			if front != nil && !front.spilled {
+				select {
+				case r, ok := <-in:
+					if !ok {
+						in = nil
+						continue
+					}
+					enqueue(r)
+				case out <- front.rev:
+					pending.Remove(pending.Front())
+					size := int64(len(front.rev.Text))
+					pageUsed -= size
+					c.track(-size)
+				case <-ctx.Done():
+					return
+				}
+				continue
+			}
+
+			if front == nil {
+				select {
+				case r, ok := <-in:
+					if !ok {
+						in = nil
+						continue
+					}
+					enqueue(r)
+				case <-ctx.Done():
+					return
+				}
+				continue
+			}
+
+			//front is spilled: give in a non-blocking chance first, so the cache keeps
+			//draining instead of rehydrating a revision that might not even be sent this
+			//round; only once there is nothing else to do do we pay for the disk read.
+			select {
+			case r, ok := <-in:
+				if !ok {
+					in = nil
+				} else {
+					enqueue(r)
+				}
+				continue
+			default:
+			}
+
+			rev := c.rehydrate(front)
+			select {
+			case out <- rev:
+				pending.Remove(pending.Front())
+				c.track(-int64(len(rev.Text))) //cancels the += rehydrate just tracked, now that it's been delivered
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return out
+}
+
+func frontOf(pending *list.List) *queuedRevision {
+	e := pending.Front()
+	if e == nil {
+		return nil
+	}
+	return e.Value.(*queuedRevision)
+}
+
+func (c *Cache) track(delta int64) {
+	c.mu.Lock()
+	c.used += delta
+	c.mu.Unlock()
+}
+
+func (c *Cache) over() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.used > c.opts.MaxTotalBytes
+}
+
+func (c *Cache) overPage(pageUsed int64) bool {
+	return c.opts.MaxPageBytes > 0 && pageUsed > c.opts.MaxPageBytes
+}
+
+//evictCold spills the Text of the oldest not-yet-spilled pending revisions to disk,
+//front (coldest) first, until the cache's tracked global usage is back under
+//MaxTotalBytes and pageUsed, this page's own in-memory bytes, is back under
+//MaxPageBytes. It returns pageUsed, decremented by whatever it spilled.
+func (c *Cache) evictCold(pending *list.List, pageUsed int64) int64 {
+	for e := pending.Front(); e != nil && (c.over() || c.overPage(pageUsed)); e = e.Next() {
+		qr := e.Value.(*queuedRevision)
+		if qr.spilled || len(qr.rev.Text) == 0 {
+			continue
+		}
+		size := int64(len(qr.rev.Text))
+		if err := c.evict(qr); err != nil {
+			return pageUsed //best effort: keep the text in memory rather than losing it
+		}
+		pageUsed -= size
+	}
+	return pageUsed
+}
+
+func (c *Cache) evict(qr *queuedRevision) error {
+	offset, err := c.write(qr.rev.Text)
+	if err != nil {
+		return err
+	}
+
+	qr.offset, qr.size = offset, int64(len(qr.rev.Text))
+	qr.spilled = true
+
+	c.mu.Lock()
+	c.used -= qr.size
+	c.evictions++
+	c.mu.Unlock()
+
+	qr.rev.Text = ""
+	return nil
+}
+
+func (c *Cache) rehydrate(qr *queuedRevision) Revision {
+	if !qr.spilled {
+		return qr.rev
+	}
+
+	text, err := c.read(qr.offset, qr.size)
+	if err != nil {
+		return qr.rev //best effort: deliver with Text lost rather than blocking forever
+	}
+
+	qr.rev.Text = text
+	qr.spilled = false
+
+	c.mu.Lock()
+	c.used += qr.size
+	c.hits++
+	c.mu.Unlock()
+
+	return qr.rev
+}
+
+func (c *Cache) write(text string) (offset int64, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	offset = c.offset
+	n, err := c.spillFile.Write([]byte(text))
+	c.offset += int64(n)
+	return offset, err
+}
+
+func (c *Cache) read(offset, size int64) (string, error) {
+	buf := make([]byte, size)
+	if _, err := c.spillFile.ReadAt(buf, offset); err != nil {
+		return "", err
+	}
+	return string(buf), nil
+}
@@ -0,0 +1,117 @@
+package wikibrief
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestCacheEvictAndRehydrate(t *testing.T) {
+	c, err := newCache(t.TempDir(), CacheOptions{MaxTotalBytes: 16})
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	defer c.Close()
+
+	text := strings.Repeat("x", 20) //bigger than MaxTotalBytes, so every revision is evicted as soon as it is queued
+
+	in := make(chan Revision)
+	out := c.spool(context.Background(), in)
+
+	go func() {
+		defer close(in)
+		for i := uint32(0); i < 5; i++ {
+			in <- Revision{ID: i, Text: text}
+		}
+	}()
+
+	var got []Revision
+	for r := range out {
+		got = append(got, r)
+	}
+
+	if len(got) != 5 {
+		t.Fatalf("Expecting 5 revisions out, found %d", len(got))
+	}
+	for i, r := range got {
+		if r.ID != uint32(i) {
+			t.Errorf("Expecting revisions delivered in order, found %d at position %d", r.ID, i)
+		}
+		if r.Text != text {
+			t.Errorf("Expecting revision %d's Text rehydrated from disk, found %q", r.ID, r.Text)
+		}
+	}
+
+	stats := c.Stats()
+	if stats.Evictions == 0 {
+		t.Error("Expecting at least one eviction under a MaxTotalBytes tighter than a single revision's Text")
+	}
+	if stats.Hits != stats.Evictions {
+		t.Errorf("Expecting every eviction to be rehydrated exactly once before delivery, found %d evictions and %d hits", stats.Evictions, stats.Hits)
+	}
+	if stats.BytesInUse != 0 {
+		t.Errorf("Expecting no bytes left tracked in use once every revision has been drained, found %d", stats.BytesInUse)
+	}
+}
+
+func TestCachePerPageBudgetEnforced(t *testing.T) {
+	c, err := newCache(t.TempDir(), CacheOptions{MaxTotalBytes: 1 << 20, MaxPageBytes: 16})
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	defer c.Close()
+
+	text := strings.Repeat("x", 20) //bigger than MaxPageBytes alone, even though MaxTotalBytes has ample headroom
+
+	in := make(chan Revision)
+	out := c.spool(context.Background(), in)
+
+	go func() {
+		defer close(in)
+		for i := uint32(0); i < 3; i++ {
+			in <- Revision{ID: i, Text: text}
+		}
+	}()
+
+	var got []Revision
+	for r := range out {
+		got = append(got, r)
+	}
+
+	if len(got) != 3 {
+		t.Fatalf("Expecting 3 revisions out, found %d", len(got))
+	}
+	for i, r := range got {
+		if r.Text != text {
+			t.Errorf("Expecting revision %d's Text rehydrated from disk, found %q", i, r.Text)
+		}
+	}
+
+	if stats := c.Stats(); stats.Evictions == 0 {
+		t.Error("Expecting MaxPageBytes alone to force evictions even though MaxTotalBytes is nowhere near exceeded")
+	}
+}
+
+func TestCacheDisabledSkipsSpillFile(t *testing.T) {
+	c, err := newCache(t.TempDir(), CacheOptions{})
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	defer c.Close()
+
+	if c.spillFile != nil {
+		t.Error("Expecting a zero-value CacheOptions not to allocate a spill file")
+	}
+
+	in := make(chan Revision, 1)
+	in <- Revision{ID: 1, Text: "unchanged"}
+	close(in)
+
+	out := c.spool(context.Background(), in)
+	if out != in {
+		//not fatal on its own, but spool is documented as a transparent pass-through with no budget configured
+		t.Error("Expecting spool to pass in through unchanged with no budget configured")
+	}
+	for range out {
+	}
+}
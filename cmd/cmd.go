@@ -17,7 +17,8 @@ func main() {
 	}()
 
 	ctx, fail := ctxutils.WithFail(context.Background())
-	pages := wikibrief.New(ctx, fail, "/tmp", "it")
+	pages, cache := wikibrief.New(ctx, fail, "/tmp", "it", false)
+	defer cache.Close()
 	wg := sync.WaitGroup{}
 	for i := 0; i < 200; i++ {
 		wg.Add(1)
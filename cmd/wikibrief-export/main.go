@@ -0,0 +1,68 @@
+//Command wikibrief-export digests a wikipedia dump with wikibrief and streams the
+//result to a file in JSON Lines, NDJSON or Parquet.
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"os"
+
+	"github.com/ebonetti/ctxutils"
+
+	"github.com/negapedia/wikibrief"
+	"github.com/negapedia/wikibrief/encoding"
+)
+
+func main() {
+	tmpDir := flag.String("tmpdir", "/tmp", "scratch directory for downloaded dump files")
+	lang := flag.String("lang", "en", "wikipedia language edition to digest")
+	format := flag.String("format", "jsonl", "output format: jsonl, ndjson or parquet")
+	out := flag.String("out", "-", "output file, \"-\" for stdout")
+	compression := flag.String("compression", "snappy", "parquet compression codec: snappy, zstd or none")
+	flag.Parse()
+
+	w := os.Stdout
+	if *out != "-" {
+		f, err := os.Create(*out)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer f.Close()
+		w = f
+	}
+
+	ctx, fail := ctxutils.WithFail(context.Background())
+	pages, cache := wikibrief.New(ctx, fail, *tmpDir, *lang, false)
+	defer cache.Close()
+
+	var err error
+	switch *format {
+	case "jsonl":
+		err = encoding.NewJSONLinesWriter(w).WriteAll(pages)
+	case "ndjson":
+		err = encoding.NewNDJSONWriter(w).WriteAll(pages)
+	case "parquet":
+		err = encoding.NewParquetWriter(w, encoding.Options{Compression: parseCompression(*compression)}).WriteAll(pages)
+	default:
+		log.Fatalf("wikibrief-export: unknown format %q", *format)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if err := fail(nil); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func parseCompression(s string) encoding.Compression {
+	switch s {
+	case "zstd":
+		return encoding.CompressionZstd
+	case "none", "uncompressed":
+		return encoding.CompressionUncompressed
+	default:
+		return encoding.CompressionSnappy
+	}
+}
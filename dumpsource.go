@@ -0,0 +1,352 @@
+package wikibrief
+
+import (
+	"compress/bzip2"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/negapedia/wikidump"
+
+	errorsOnSteroids "github.com/pkg/errors"
+)
+
+//DumpSource abstracts where New reads a language's dump files from, so callers can pin
+//a reproducible build, mirror a dump internally, or ingest a custom dump without
+//touching wikibrief's internals. New defaults to LatestDump(tmpDir, lang); pass a
+//different DumpSource via WithDumpSource.
+type DumpSource interface {
+	//Lang is the ISO code of the wikipedia language edition the source serves.
+	Lang() string
+	//Date is the dump's publication date, or the zero time if unknown ahead of time.
+	Date() time.Time
+	//ExpectedFiles is the number of metahistory dump files the source will yield, or 0 if unknown.
+	ExpectedFiles() int
+	//Iter returns an iterator yielding the source's dump files one at a time; the
+	//iterator returns io.EOF once there are no more files left.
+	Iter(ctx context.Context) func(context.Context) (io.ReadCloser, error)
+}
+
+/////////////////////////////////////////////////////////////////////////////////////
+
+//latestDumpSource is the historical behaviour: the most recent metahistory7zdump.
+type latestDumpSource struct {
+	lang string
+	dump wikidump.Wikidump
+}
+
+//LatestDump serves the most recent metahistory7zdump published for lang, fetched (and
+//cached) under tmpDir.
+func LatestDump(tmpDir, lang string) (DumpSource, error) {
+	dump, err := wikidump.Latest(tmpDir, lang, "metahistory7zdump",
+		"pagetable", "redirecttable", "categorylinkstable", "pagelinkstable")
+	if err != nil {
+		return nil, err
+	}
+	return &latestDumpSource{lang, dump}, nil
+}
+
+func (s *latestDumpSource) Lang() string       { return s.lang }
+func (s *latestDumpSource) Date() time.Time    { return time.Time{} }
+func (s *latestDumpSource) ExpectedFiles() int { return 0 }
+func (s *latestDumpSource) Iter(ctx context.Context) func(context.Context) (io.ReadCloser, error) {
+	return s.dump.Open("metahistory7zdump")
+}
+
+/////////////////////////////////////////////////////////////////////////////////////
+
+//datedDumpSource pins the digest to a specific, already published dump.
+type datedDumpSource struct {
+	lang string
+	date time.Time
+	dump wikidump.Wikidump
+}
+
+//AtDate pins the digest to the metahistory7zdump published for lang on date, instead
+//of whatever is currently latest, so the resulting digest is reproducible across runs.
+func AtDate(tmpDir, lang string, date time.Time) (DumpSource, error) {
+	dump, err := wikidump.From(tmpDir, lang, date)
+	if err != nil {
+		return nil, err
+	}
+	if err := dump.CheckFor("metahistory7zdump", "pagetable", "redirecttable", "categorylinkstable", "pagelinkstable"); err != nil {
+		return nil, err
+	}
+	return &datedDumpSource{lang, date, dump}, nil
+}
+
+func (s *datedDumpSource) Lang() string       { return s.lang }
+func (s *datedDumpSource) Date() time.Time    { return s.date }
+func (s *datedDumpSource) ExpectedFiles() int { return 0 }
+func (s *datedDumpSource) Iter(ctx context.Context) func(context.Context) (io.ReadCloser, error) {
+	return s.dump.Open("metahistory7zdump")
+}
+
+/////////////////////////////////////////////////////////////////////////////////////
+
+//localDirectorySource serves pre-downloaded dump files straight off disk.
+type localDirectorySource struct {
+	lang  string
+	files []string
+}
+
+//LocalDirectory serves every .7z/.xml.bz2/.xml dump file found directly under dir, in
+//lexical order, letting callers ingest a custom or pre-downloaded dump without
+//touching the network.
+func LocalDirectory(dir, lang string) (DumpSource, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, errorsOnSteroids.Wrapf(err, "Error while listing local dump directory %q", dir)
+	}
+
+	var files []string
+	for _, e := range entries {
+		name := e.Name()
+		if !e.IsDir() && (strings.HasSuffix(name, ".7z") || strings.HasSuffix(name, ".xml.bz2") || strings.HasSuffix(name, ".xml")) {
+			files = append(files, filepath.Join(dir, name))
+		}
+	}
+	sort.Strings(files)
+
+	return &localDirectorySource{lang, files}, nil
+}
+
+func (s *localDirectorySource) Lang() string       { return s.lang }
+func (s *localDirectorySource) Date() time.Time    { return time.Time{} }
+func (s *localDirectorySource) ExpectedFiles() int { return len(s.files) }
+func (s *localDirectorySource) Iter(ctx context.Context) func(context.Context) (io.ReadCloser, error) {
+	files := s.files
+	return func(ctx context.Context) (io.ReadCloser, error) {
+		if len(files) == 0 {
+			return nil, io.EOF
+		}
+
+		path := files[0]
+		files = files[1:]
+		return openLocalDumpFile(path)
+	}
+}
+
+func openLocalDumpFile(path string) (io.ReadCloser, error) {
+	if strings.HasSuffix(path, ".7z") {
+		return open7z(path)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, errorsOnSteroids.Wrapf(err, "Error while opening local dump file %q", path)
+	}
+
+	if strings.HasSuffix(path, ".xml.bz2") {
+		return namedReadCloser{bzip2.NewReader(f), f, path}, nil
+	}
+	return f, nil
+}
+
+//open7z shells out to the 7z binary, mirroring how metahistory7zdump files are
+//extracted elsewhere in the wikidump pipeline.
+func open7z(path string) (io.ReadCloser, error) {
+	cmd := exec.Command("7z", "x", "-so", path)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, errorsOnSteroids.Wrapf(err, "Error while preparing 7z extraction of %q", path)
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, errorsOnSteroids.Wrapf(err, "Error while starting 7z extraction of %q", path)
+	}
+	return namedReadCloser{stdout, cmdCloser{cmd}, path}, nil
+}
+
+type cmdCloser struct{ cmd *exec.Cmd }
+
+func (c cmdCloser) Close() error {
+	c.cmd.Process.Kill()
+	return c.cmd.Wait()
+}
+
+//namedReadCloser pairs a Reader with a Closer and a Name, the latter so errorContext
+//can still report the originating filename - see wikibrief.go's filename helper.
+type namedReadCloser struct {
+	io.Reader
+	closer io.Closer
+	name   string
+}
+
+func (n namedReadCloser) Close() error { return n.closer.Close() }
+func (n namedReadCloser) Name() string { return n.name }
+
+/////////////////////////////////////////////////////////////////////////////////////
+
+//MirrorManifest is the JSON document HTTPMirrors polls to discover the dump files to
+//serve and, for each, the candidate mirrors that currently carry it.
+type MirrorManifest struct {
+	Files []MirrorFile `json:"files"`
+}
+
+//MirrorFile is a single dump file and the mirror URLs that currently serve it, in
+//preference order.
+type MirrorFile struct {
+	Name    string   `json:"name"`
+	Mirrors []string `json:"mirrors"`
+}
+
+//httpMirrorSource resolves dump files from a manifest polled at Iter time, failing
+//over between mirrors much like a Consul-style service discovery client would.
+type httpMirrorSource struct {
+	manifestURL, lang string
+	client            *http.Client
+}
+
+//HTTPMirrors polls manifestURL for the current list of healthy mirrors serving lang's
+//dump files, picks one per file and fails over to the next candidate on a read error,
+//resuming from the byte offset already delivered via an HTTP Range request.
+//client defaults to http.DefaultClient when nil.
+func HTTPMirrors(manifestURL, lang string, client *http.Client) DumpSource {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &httpMirrorSource{manifestURL, lang, client}
+}
+
+func (s *httpMirrorSource) Lang() string       { return s.lang }
+func (s *httpMirrorSource) Date() time.Time    { return time.Time{} }
+func (s *httpMirrorSource) ExpectedFiles() int { return 0 }
+
+func (s *httpMirrorSource) Iter(ctx context.Context) func(context.Context) (io.ReadCloser, error) {
+	var manifest *MirrorManifest
+	var next int
+	return func(ctx context.Context) (io.ReadCloser, error) {
+		if manifest == nil {
+			m, err := s.fetchManifest(ctx)
+			if err != nil {
+				return nil, err
+			}
+			manifest = m
+		}
+
+		if next >= len(manifest.Files) {
+			return nil, io.EOF
+		}
+
+		file := manifest.Files[next]
+		next++
+
+		r := &failoverReader{ctx: ctx, client: s.client, mirrors: file.Mirrors, name: file.Name}
+		if err := r.dial(); err != nil {
+			return nil, errorsOnSteroids.Wrapf(err, "Error while resolving a healthy mirror for %q", file.Name)
+		}
+		return r, nil
+	}
+}
+
+func (s *httpMirrorSource) fetchManifest(ctx context.Context) (*MirrorManifest, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.manifestURL, nil)
+	if err != nil {
+		return nil, errorsOnSteroids.Wrapf(err, "Error while building manifest request for %q", s.manifestURL)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, errorsOnSteroids.Wrapf(err, "Error while polling mirror manifest %q", s.manifestURL)
+	}
+	defer resp.Body.Close()
+
+	var m MirrorManifest
+	if err := json.NewDecoder(resp.Body).Decode(&m); err != nil {
+		return nil, errorsOnSteroids.Wrapf(err, "Error while decoding mirror manifest %q", s.manifestURL)
+	}
+	return &m, nil
+}
+
+//failoverReader reads from the first healthy mirror in mirrors and, on a read error,
+//resumes the file from offset on the next candidate rather than giving up - restarting
+//the byte stream from scratch would splice the file's header into wherever the caller's
+//decoder currently stands.
+type failoverReader struct {
+	ctx     context.Context
+	client  *http.Client
+	mirrors []string
+	name    string
+	idx     int
+	offset  int64
+	current io.ReadCloser
+}
+
+//dial connects to the next candidate mirror, resuming from r.offset via an HTTP Range
+//request when this isn't the first attempt; a mirror that ignores the Range header and
+//replies with the whole file from byte 0 has its already-delivered prefix discarded
+//instead, so either way the caller sees the stream continue from where it left off.
+func (r *failoverReader) dial() error {
+	for r.idx < len(r.mirrors) {
+		url := r.mirrors[r.idx]
+		r.idx++
+
+		req, err := http.NewRequestWithContext(r.ctx, http.MethodGet, url, nil)
+		if err != nil {
+			continue
+		}
+		if r.offset > 0 {
+			req.Header.Set("Range", fmt.Sprintf("bytes=%d-", r.offset))
+		}
+
+		resp, err := r.client.Do(req)
+		if err != nil {
+			continue
+		}
+
+		switch {
+		case resp.StatusCode == http.StatusPartialContent:
+			//mirror honored Range and starts exactly at r.offset
+		case resp.StatusCode == http.StatusOK && r.offset == 0:
+			//first attempt at this file, nothing to skip
+		case resp.StatusCode == http.StatusOK:
+			//mirror ignored Range and replayed the file from scratch: skip what was already delivered
+			if _, err := io.CopyN(io.Discard, resp.Body, r.offset); err != nil {
+				resp.Body.Close()
+				continue
+			}
+		default:
+			resp.Body.Close()
+			continue
+		}
+
+		r.current = resp.Body
+		return nil
+	}
+	return fmt.Errorf("wikibrief: no healthy mirror left for %q", r.name)
+}
+
+func (r *failoverReader) Read(p []byte) (int, error) {
+	n, err := r.current.Read(p)
+	r.offset += int64(n)
+
+	//A partial read alongside an error is returned as-is per io.Reader's contract, so the
+	//caller sees the bytes already delivered; failover is only attempted once a Read
+	//yields nothing at all, never by discarding bytes already handed to the caller.
+	if n > 0 || err == nil || err == io.EOF || r.idx >= len(r.mirrors) {
+		return n, err
+	}
+
+	r.current.Close()
+	if dialErr := r.dial(); dialErr != nil {
+		return n, err
+	}
+	return r.Read(p)
+}
+
+func (r *failoverReader) Close() error {
+	if r.current != nil {
+		return r.current.Close()
+	}
+	return nil
+}
+
+func (r *failoverReader) Name() string { return r.name }
@@ -0,0 +1,164 @@
+package wikibrief
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLocalDirectoryOrdersAndFiltersFiles(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"b.xml", "a.xml", "ignored.txt"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(name), 0o644); err != nil {
+			t.Fatalf("%+v", err)
+		}
+	}
+
+	src, err := LocalDirectory(dir, "en")
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	if src.Lang() != "en" {
+		t.Errorf("Expecting Lang() to return %q, found %q", "en", src.Lang())
+	}
+	if src.ExpectedFiles() != 2 {
+		t.Errorf("Expecting 2 matching files, found %d", src.ExpectedFiles())
+	}
+
+	next := src.Iter(context.Background())
+	var got []string
+	for {
+		rc, err := next(context.Background())
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("%+v", err)
+		}
+		b, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatalf("%+v", err)
+		}
+		got = append(got, string(b))
+	}
+
+	if len(got) != 2 || got[0] != "a.xml" || got[1] != "b.xml" {
+		t.Errorf("Expecting files in lexical order [a.xml b.xml], found %v", got)
+	}
+}
+
+func TestHTTPMirrorsFailsOverToNextMirror(t *testing.T) {
+	const body = "revision history"
+
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer failing.Close()
+
+	healthy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, body)
+	}))
+	defer healthy.Close()
+
+	manifest := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(MirrorManifest{Files: []MirrorFile{
+			{Name: "enwiki-metahistory7zdump.xml", Mirrors: []string{failing.URL, healthy.URL}},
+		}})
+	}))
+	defer manifest.Close()
+
+	src := HTTPMirrors(manifest.URL, "en", nil)
+
+	next := src.Iter(context.Background())
+	rc, err := next(context.Background())
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	defer rc.Close()
+
+	b, err := io.ReadAll(rc)
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	if string(b) != body {
+		t.Errorf("Expecting failover to the healthy mirror's body %q, found %q", body, string(b))
+	}
+
+	if _, err := next(context.Background()); err != io.EOF {
+		t.Errorf("Expecting io.EOF once every manifest file has been served, found %v", err)
+	}
+}
+
+func TestFailoverReaderResumesFromOffsetOnMidStreamError(t *testing.T) {
+	const full = "0123456789ABCDEF"
+	const cut = 4 //bytes served by the failing mirror before its connection drops
+
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", fmt.Sprint(len(full)))
+		w.WriteHeader(http.StatusOK)
+		io.WriteString(w, full[:cut])
+
+		hj, ok := w.(http.Hijacker)
+		if !ok {
+			t.Error("ResponseWriter does not support hijacking")
+			return
+		}
+		conn, _, err := hj.Hijack()
+		if err != nil {
+			t.Errorf("%+v", err)
+			return
+		}
+		conn.Close() //drop the connection mid-file, as a flaky mirror would
+	}))
+	defer failing.Close()
+
+	resuming := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if want := fmt.Sprintf("bytes=%d-", cut); r.Header.Get("Range") != want {
+			t.Errorf("Expecting a resume request with Range %q, found %q", want, r.Header.Get("Range"))
+		}
+		w.WriteHeader(http.StatusPartialContent)
+		io.WriteString(w, full[cut:])
+	}))
+	defer resuming.Close()
+
+	r := &failoverReader{ctx: context.Background(), client: http.DefaultClient, mirrors: []string{failing.URL, resuming.URL}, name: "dump.xml"}
+	if err := r.dial(); err != nil {
+		t.Fatalf("%+v", err)
+	}
+	defer r.Close()
+
+	got, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	if string(got) != full {
+		t.Errorf("Expecting the failover to stitch the two mirrors into %q, found %q", full, got)
+	}
+}
+
+func TestHTTPMirrorsErrorsWhenAllMirrorsFail(t *testing.T) {
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer failing.Close()
+
+	manifest := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(MirrorManifest{Files: []MirrorFile{
+			{Name: "enwiki-metahistory7zdump.xml", Mirrors: []string{failing.URL}},
+		}})
+	}))
+	defer manifest.Close()
+
+	src := HTTPMirrors(manifest.URL, "en", nil)
+
+	if _, err := src.Iter(context.Background())(context.Background()); err == nil {
+		t.Error("Expecting an error once every candidate mirror for a file has failed")
+	}
+}
@@ -0,0 +1,60 @@
+package encoding
+
+import (
+	"encoding/json"
+	"io"
+
+	"github.com/negapedia/wikibrief"
+)
+
+//JSONLinesWriter writes one JSON object per revision, Record-flattened, one per line.
+type JSONLinesWriter struct {
+	enc *json.Encoder
+}
+
+//NewJSONLinesWriter returns a JSONLinesWriter writing to w.
+func NewJSONLinesWriter(w io.Writer) *JSONLinesWriter {
+	return &JSONLinesWriter{json.NewEncoder(w)}
+}
+
+//WriteAll drains pages, writing one Record line per revision. pages and every page's
+//Revisions channel are fully drained even past the first encoding error, so upstream
+//producers are never left blocked; the first error encountered, if any, is returned.
+func (w *JSONLinesWriter) WriteAll(pages <-chan wikibrief.EvolvingPage) error {
+	var firstErr error
+	for p := range pages {
+		for r := range p.Revisions {
+			if firstErr == nil {
+				firstErr = w.enc.Encode(recordOf(p, r))
+			}
+		}
+	}
+	return firstErr
+}
+
+//NDJSONWriter writes one JSON object per page, each nested with all of its revisions.
+type NDJSONWriter struct {
+	enc *json.Encoder
+}
+
+//NewNDJSONWriter returns a NDJSONWriter writing to w.
+func NewNDJSONWriter(w io.Writer) *NDJSONWriter {
+	return &NDJSONWriter{json.NewEncoder(w)}
+}
+
+//WriteAll drains pages, writing one PageRecord line per page. pages and every page's
+//Revisions channel are fully drained even past the first encoding error, so upstream
+//producers are never left blocked; the first error encountered, if any, is returned.
+func (w *NDJSONWriter) WriteAll(pages <-chan wikibrief.EvolvingPage) error {
+	var firstErr error
+	for p := range pages {
+		pr := pageRecordOf(p)
+		for r := range p.Revisions {
+			pr.Revisions = append(pr.Revisions, revisionRecordOf(r))
+		}
+		if firstErr == nil {
+			firstErr = w.enc.Encode(pr)
+		}
+	}
+	return firstErr
+}
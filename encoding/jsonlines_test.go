@@ -0,0 +1,90 @@
+package encoding
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/negapedia/wikibrief"
+)
+
+func fakePages(pages ...wikibrief.EvolvingPage) <-chan wikibrief.EvolvingPage {
+	ch := make(chan wikibrief.EvolvingPage, len(pages))
+	for _, p := range pages {
+		ch <- p
+	}
+	close(ch)
+	return ch
+}
+
+func fakeRevisions(revs ...wikibrief.Revision) <-chan wikibrief.Revision {
+	ch := make(chan wikibrief.Revision, len(revs))
+	for _, r := range revs {
+		ch <- r
+	}
+	close(ch)
+	return ch
+}
+
+func TestJSONLinesWriterWriteAll(t *testing.T) {
+	ts := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	page := wikibrief.EvolvingPage{
+		PageID: 1, Title: "Go", TopicID: 7,
+		Revisions: fakeRevisions(
+			wikibrief.Revision{ID: 10, UserID: 20, SHA1: "abc", Timestamp: ts},
+			wikibrief.Revision{ID: 11, UserID: 21, SHA1: "def", IsRevert: 1, Timestamp: ts},
+		),
+	}
+
+	var buf bytes.Buffer
+	if err := NewJSONLinesWriter(&buf).WriteAll(fakePages(page)); err != nil {
+		t.Fatalf("%+v", err)
+	}
+
+	dec := json.NewDecoder(&buf)
+	var got []Record
+	for dec.More() {
+		var r Record
+		if err := dec.Decode(&r); err != nil {
+			t.Fatalf("%+v", err)
+		}
+		got = append(got, r)
+	}
+
+	if len(got) != 2 {
+		t.Fatalf("Expecting 2 Record lines, found %d", len(got))
+	}
+	if got[0].PageID != 1 || got[0].TopicID != 7 || got[0].Title != "Go" || got[0].RevisionID != 10 {
+		t.Errorf("Expecting the page's fields flattened onto the first revision, found %+v", got[0])
+	}
+	if got[1].RevisionID != 11 || got[1].IsRevert != 1 {
+		t.Errorf("Expecting the second revision's own fields preserved, found %+v", got[1])
+	}
+}
+
+func TestNDJSONWriterWriteAll(t *testing.T) {
+	page := wikibrief.EvolvingPage{
+		PageID: 2, Title: "Rust", TopicID: 3,
+		Revisions: fakeRevisions(
+			wikibrief.Revision{ID: 30, UserID: 40, SHA1: "ghi"},
+		),
+	}
+
+	var buf bytes.Buffer
+	if err := NewNDJSONWriter(&buf).WriteAll(fakePages(page)); err != nil {
+		t.Fatalf("%+v", err)
+	}
+
+	var got PageRecord
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("%+v", err)
+	}
+
+	if got.PageID != 2 || got.Title != "Rust" {
+		t.Errorf("Expecting the page's own fields on the PageRecord, found %+v", got)
+	}
+	if len(got.Revisions) != 1 || got.Revisions[0].RevisionID != 30 {
+		t.Errorf("Expecting the page's single revision nested under Revisions, found %+v", got.Revisions)
+	}
+}
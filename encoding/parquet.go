@@ -0,0 +1,105 @@
+package encoding
+
+import (
+	"io"
+
+	"github.com/negapedia/wikibrief"
+	"github.com/parquet-go/parquet-go"
+	"github.com/parquet-go/parquet-go/compress"
+
+	errorsOnSteroids "github.com/pkg/errors"
+)
+
+//Compression selects the codec ParquetWriter applies to every column.
+type Compression int
+
+const (
+	//CompressionSnappy is ParquetWriter's default codec.
+	CompressionSnappy Compression = iota
+	CompressionZstd
+	CompressionUncompressed
+)
+
+func (c Compression) codec() compress.Codec {
+	switch c {
+	case CompressionZstd:
+		return &parquet.Zstd
+	case CompressionUncompressed:
+		return &parquet.Uncompressed
+	default:
+		return &parquet.Snappy
+	}
+}
+
+//Options tunes ParquetWriter's row group batching and column compression.
+type Options struct {
+	//RowGroupSize is the number of records buffered before a row group is flushed to w.
+	//Zero defaults to 128Ki records.
+	RowGroupSize int
+	//Compression selects the per-column codec; the zero value is CompressionSnappy.
+	Compression Compression
+}
+
+//defaultRowGroupSize keeps a single row group's buffered Records to a size that stays
+//tractable in memory for the multi-hundred-GB outputs this package targets.
+const defaultRowGroupSize = 128 * 1024
+
+//ParquetWriter batches Record rows into row groups and writes them to w, compressed per
+//opts.Compression, so downstream analytics over the multi-hundred-GB digest stays tractable.
+type ParquetWriter struct {
+	w            *parquet.GenericWriter[Record]
+	rowGroupSize int
+	buffered     int
+}
+
+//NewParquetWriter returns a ParquetWriter writing to w per opts.
+func NewParquetWriter(w io.Writer, opts Options) *ParquetWriter {
+	rowGroupSize := opts.RowGroupSize
+	if rowGroupSize <= 0 {
+		rowGroupSize = defaultRowGroupSize
+	}
+
+	return &ParquetWriter{
+		w:            parquet.NewGenericWriter[Record](w, parquet.Compression(opts.Compression.codec())),
+		rowGroupSize: rowGroupSize,
+	}
+}
+
+//WriteAll drains pages, writing one Record row per revision and flushing a row group
+//every RowGroupSize rows. pages and every page's Revisions channel are fully drained
+//even past the first error, so upstream producers are never left blocked; the first
+//error encountered, if any, is returned, wrapped with context.
+func (pw *ParquetWriter) WriteAll(pages <-chan wikibrief.EvolvingPage) error {
+	var firstErr error
+	fail := func(err error) {
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	for p := range pages {
+		for r := range p.Revisions {
+			if firstErr != nil {
+				continue
+			}
+
+			if _, err := pw.w.Write([]Record{recordOf(p, r)}); err != nil {
+				fail(errorsOnSteroids.Wrap(err, "Error while writing parquet row"))
+				continue
+			}
+
+			if pw.buffered++; pw.buffered >= pw.rowGroupSize {
+				if err := pw.w.Flush(); err != nil {
+					fail(errorsOnSteroids.Wrap(err, "Error while flushing parquet row group"))
+				}
+				pw.buffered = 0
+			}
+		}
+	}
+
+	if err := pw.w.Close(); err != nil {
+		fail(errorsOnSteroids.Wrap(err, "Error while closing parquet writer"))
+	}
+
+	return firstErr
+}
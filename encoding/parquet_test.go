@@ -0,0 +1,26 @@
+package encoding
+
+import (
+	"testing"
+
+	"github.com/parquet-go/parquet-go"
+	"github.com/parquet-go/parquet-go/compress"
+)
+
+func TestCompressionCodec(t *testing.T) {
+	cases := []struct {
+		c    Compression
+		want compress.Codec
+	}{
+		{CompressionSnappy, &parquet.Snappy},
+		{CompressionZstd, &parquet.Zstd},
+		{CompressionUncompressed, &parquet.Uncompressed},
+		{Compression(99), &parquet.Snappy}, //unrecognized values fall back to the default codec
+	}
+
+	for _, c := range cases {
+		if got := c.c.codec(); got != c.want {
+			t.Errorf("Compression(%d).codec(): expected %v, found %v", c.c, c.want, got)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+//Package encoding streams a wikibrief digest out to disk, in JSON Lines or Parquet with
+//one record per revision, or in NDJSON with one record per page nesting its revisions,
+//so consumers no longer have to write their own goroutines over EvolvingPage/Revision channels.
+package encoding
+
+import (
+	"time"
+
+	"github.com/negapedia/wikibrief"
+)
+
+//Record is one flattened revision: the stable, documented schema shared by
+//JSONLinesWriter and ParquetWriter. Every field of the owning EvolvingPage is
+//duplicated onto each of its revisions.
+type Record struct {
+	PageID     uint32    `json:"page_id" parquet:"page_id"`
+	TopicID    uint32    `json:"topic_id" parquet:"topic_id"`
+	Title      string    `json:"title" parquet:"title"`
+	Abstract   string    `json:"abstract" parquet:"abstract"`
+	RevisionID uint32    `json:"revision_id" parquet:"revision_id"`
+	UserID     uint32    `json:"user_id" parquet:"user_id"`
+	IsBot      bool      `json:"is_bot" parquet:"is_bot"`
+	SHA1       string    `json:"sha1" parquet:"sha1"`
+	IsRevert   uint32    `json:"is_revert" parquet:"is_revert"`
+	Timestamp  time.Time `json:"timestamp" parquet:"timestamp,timestamp"`
+	Text       string    `json:"text" parquet:"text"`
+}
+
+//recordOf flattens r, a revision of p, into the schema every writer in this package emits.
+func recordOf(p wikibrief.EvolvingPage, r wikibrief.Revision) Record {
+	return Record{
+		PageID:     p.PageID,
+		TopicID:    p.TopicID,
+		Title:      p.Title,
+		Abstract:   p.Abstract,
+		RevisionID: r.ID,
+		UserID:     r.UserID,
+		IsBot:      r.IsBot,
+		SHA1:       r.SHA1,
+		IsRevert:   r.IsRevert,
+		Timestamp:  r.Timestamp,
+		Text:       r.Text,
+	}
+}
+
+//PageRecord is one page nested with all of its revisions: the framing NDJSONWriter uses
+//instead of Record's one-line-per-revision flattening.
+type PageRecord struct {
+	PageID    uint32           `json:"page_id"`
+	TopicID   uint32           `json:"topic_id"`
+	Title     string           `json:"title"`
+	Abstract  string           `json:"abstract"`
+	Revisions []RevisionRecord `json:"revisions"`
+}
+
+//RevisionRecord is a single revision nested inside a PageRecord.
+type RevisionRecord struct {
+	RevisionID uint32    `json:"revision_id"`
+	UserID     uint32    `json:"user_id"`
+	IsBot      bool      `json:"is_bot"`
+	SHA1       string    `json:"sha1"`
+	IsRevert   uint32    `json:"is_revert"`
+	Timestamp  time.Time `json:"timestamp"`
+	Text       string    `json:"text"`
+}
+
+func pageRecordOf(p wikibrief.EvolvingPage) PageRecord {
+	return PageRecord{PageID: p.PageID, TopicID: p.TopicID, Title: p.Title, Abstract: p.Abstract}
+}
+
+func revisionRecordOf(r wikibrief.Revision) RevisionRecord {
+	return RevisionRecord{
+		RevisionID: r.ID,
+		UserID:     r.UserID,
+		IsBot:      r.IsBot,
+		SHA1:       r.SHA1,
+		IsRevert:   r.IsRevert,
+		Timestamp:  r.Timestamp,
+		Text:       r.Text,
+	}
+}
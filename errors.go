@@ -0,0 +1,118 @@
+package wikibrief
+
+import (
+	"context"
+	"fmt"
+)
+
+//Kind classifies an Error so callers can branch on failure mode without string matching.
+type Kind int
+
+const (
+	//KindUnknown is the zero Kind. classify never returns it: causes it does not
+	//recognize are reported as KindDecoderIO.
+	KindUnknown Kind = iota
+	//KindInvalidXML marks a dump file that violates the expected MediaWiki XML schema.
+	KindInvalidXML
+	//KindDecoderIO marks a failure reading or decoding the underlying XML stream.
+	KindDecoderIO
+	//KindContextCanceled marks a failure caused by the caller-supplied context being done.
+	KindContextCanceled
+	//KindDownstreamTimeout marks a failure caused by a downstream consumer not keeping up.
+	KindDownstreamTimeout
+	//KindResumeTargetNotFound marks a resumed file whose checkpointed target page was
+	//never encountered before EOF.
+	KindResumeTargetNotFound
+)
+
+func (k Kind) String() string {
+	switch k {
+	case KindInvalidXML:
+		return "invalid xml"
+	case KindDecoderIO:
+		return "decoder io"
+	case KindContextCanceled:
+		return "context canceled"
+	case KindDownstreamTimeout:
+		return "downstream timeout"
+	case KindResumeTargetNotFound:
+		return "resume target not found"
+	default:
+		return "unknown"
+	}
+}
+
+//Error is the structured failure New reports for a single dump file, either to fail (Op
+//"digest" with Action Abort, the default) or to the OnFileError policy that observed it.
+type Error struct {
+	Op       string
+	Lang     string
+	Filename string
+	PageID   uint32
+	Title    string
+	Kind     Kind
+	Err      error
+}
+
+func (e Error) Error() string {
+	return fmt.Sprintf("wikibrief: %s %q: %s (lang %q, page %d %q): %v", e.Op, e.Filename, e.Kind, e.Lang, e.PageID, e.Title, e.Err)
+}
+
+//Unwrap returns the underlying error, so errors.Is/errors.As see through Error to it.
+func (e Error) Unwrap() error { return e.Err }
+
+//Is reports whether target is an Error of the same Kind, letting callers write
+//errors.Is(err, wikibrief.Error{Kind: wikibrief.KindInvalidXML}) instead of a type switch.
+func (e Error) Is(target error) bool {
+	t, ok := target.(Error)
+	return ok && t.Kind == e.Kind
+}
+
+//Action tells New how to proceed once OnFileError has observed a file-scoped Error.
+type Action int
+
+const (
+	//Abort stops the whole digest; it is the default behaviour when no OnFileError is set.
+	Abort Action = iota
+	//Skip discards the offending dump file and continues the digest with the rest.
+	Skip
+	//Retry re-attempts the offending dump file from wherever its stream currently stands.
+	Retry
+)
+
+//rootCause walks a github.com/pkg/errors Cause() chain down to its innermost error.
+func rootCause(err error) error {
+	for {
+		c, ok := err.(interface{ Cause() error })
+		if !ok || c.Cause() == nil {
+			return err
+		}
+		err = c.Cause()
+	}
+}
+
+//classify turns a raw error surfaced by run into the structured Error New's OnFileError
+//policy and fail see, using ec to recover the page/title the failure happened at.
+func classify(err error, lang, filename string, ec *errorContext) Error {
+	kind := KindDecoderIO
+	switch rootCause(err) {
+	case errInvalidXML:
+		kind = KindInvalidXML
+	case context.Canceled:
+		kind = KindContextCanceled
+	case context.DeadlineExceeded:
+		kind = KindDownstreamTimeout
+	case errResumeTargetNotFound:
+		kind = KindResumeTargetNotFound
+	}
+
+	return Error{
+		Op:       "digest",
+		Lang:     lang,
+		Filename: filename,
+		PageID:   ec.PageID,
+		Title:    ec.LastTitle,
+		Kind:     kind,
+		Err:      err,
+	}
+}
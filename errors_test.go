@@ -0,0 +1,58 @@
+package wikibrief
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	errorsOnSteroids "github.com/pkg/errors"
+)
+
+func TestClassify(t *testing.T) {
+	ec := &errorContext{LastTitle: "Go (programming language)", PageID: 42}
+
+	cases := []struct {
+		name string
+		err  error
+		want Kind
+	}{
+		{"invalid xml", errorsOnSteroids.Wrap(errInvalidXML, "decoder blew up"), KindInvalidXML},
+		{"context canceled", errorsOnSteroids.Wrap(context.Canceled, "ctx done"), KindContextCanceled},
+		{"downstream timeout", errorsOnSteroids.Wrap(context.DeadlineExceeded, "consumer stalled"), KindDownstreamTimeout},
+		{"resume target not found", errorsOnSteroids.Wrap(errResumeTargetNotFound, "EOF reached"), KindResumeTargetNotFound},
+		{"unrecognized cause", errorsOnSteroids.Wrap(errors.New("disk exploded"), "read failed"), KindDecoderIO},
+	}
+
+	for _, c := range cases {
+		got := classify(c.err, "en", "enwiki.xml", ec)
+		if got.Kind != c.want {
+			t.Errorf("%s: expected Kind %v, found %v", c.name, c.want, got.Kind)
+		}
+		if got.Lang != "en" || got.Filename != "enwiki.xml" || got.PageID != 42 || got.Title != ec.LastTitle {
+			t.Errorf("%s: expected classify to populate context fields from lang/filename/ec, found %+v", c.name, got)
+		}
+		if got.Unwrap() != c.err {
+			t.Errorf("%s: expected Unwrap to return the original error, found %v", c.name, got.Unwrap())
+		}
+	}
+}
+
+func TestErrorIsMatchesOnKind(t *testing.T) {
+	a := Error{Kind: KindInvalidXML, Err: errInvalidXML}
+	b := Error{Kind: KindInvalidXML, Err: errors.New("a different underlying error")}
+	c := Error{Kind: KindDecoderIO, Err: errInvalidXML}
+
+	if !errors.Is(a, b) {
+		t.Error("Expecting two Errors of the same Kind to match via errors.Is, regardless of their wrapped Err")
+	}
+	if errors.Is(a, c) {
+		t.Error("Expecting Errors of different Kind not to match via errors.Is")
+	}
+}
+
+func TestErrorUnwrap(t *testing.T) {
+	e := Error{Kind: KindInvalidXML, Err: errInvalidXML}
+	if !errors.Is(e, errInvalidXML) {
+		t.Error("Expecting errors.Is to see through Error to its wrapped Err via Unwrap")
+	}
+}
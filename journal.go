@@ -0,0 +1,169 @@
+package wikibrief
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+
+	errorsOnSteroids "github.com/pkg/errors"
+)
+
+//ResumeOptions configures whether New resumes a previously interrupted digest from its
+//on-disk journal instead of restarting it from scratch.
+type ResumeOptions struct {
+	//Resume, when true, replays JournalPath before digesting: dump files already fully
+	//drained are skipped entirely, and a partially processed one is fast-forwarded to
+	//the page checkpointed right before the process stopped.
+	Resume bool
+	//JournalPath overrides the journal's location; it otherwise defaults to
+	//<tmpDir>/<lang>.wikibrief.journal.
+	JournalPath string
+}
+
+//Reset purges the on-disk journal for lang's digest under tmpDir, so a subsequent
+//ResumeOptions.Resume starts the digest from scratch instead of resuming it.
+func Reset(tmpDir, lang string) error {
+	if err := os.Remove(defaultJournalPath(tmpDir, lang)); err != nil && !os.IsNotExist(err) {
+		return errorsOnSteroids.Wrapf(err, "Error while resetting journal for %q in %q", lang, tmpDir)
+	}
+	return nil
+}
+
+func defaultJournalPath(tmpDir, lang string) string {
+	return filepath.Join(tmpDir, lang+".wikibrief.journal")
+}
+
+//resumeState tracks the fast-forward point of a dump file being resumed: pages up to
+//and including target are skipped, then normal processing resumes for what follows.
+type resumeState struct {
+	target uint32
+	done   bool
+}
+
+//journalRecord is a single checkpoint appended to a digest's journal after a page has
+//been fully drained, or a marker recording that an entire dump file has been drained.
+type journalRecord struct {
+	Filename      string `json:"filename"`
+	PageID        uint32 `json:"pageID,omitempty"`
+	DecoderOffset int64  `json:"decoderOffset,omitempty"`
+	FileDone      bool   `json:"fileDone,omitempty"`
+}
+
+//journalBatchSize is the number of records a journal batches before fsyncing, trading
+//durability granularity (at most journalBatchSize pages replayed on resume) for I/O cost.
+const journalBatchSize = 64
+
+//journal is an append-only, fsync-batched log of digest progress, modelled on the
+//write-then-flip-a-valid-marker commit pattern: records are appended unsynced and only
+//become durable once followed by a "#valid" marker line that is itself fsynced, so a
+//crash mid-batch leaves the torn tail ignored on the next loadJournal.
+type journal struct {
+	mu      sync.Mutex
+	f       *os.File
+	enc     *json.Encoder
+	pending int
+}
+
+func newJournal(path string) (*journal, error) {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, errorsOnSteroids.Wrapf(err, "Error while opening journal %q", path)
+	}
+	return &journal{f: f, enc: json.NewEncoder(f)}, nil
+}
+
+//record appends a checkpoint for pageID, the last page fully drained from filename.
+func (j *journal) record(filename string, pageID uint32, decoderOffset int64) {
+	j.append(journalRecord{Filename: filename, PageID: pageID, DecoderOffset: decoderOffset})
+}
+
+//markFileDone appends a marker recording that filename has been fully drained.
+func (j *journal) markFileDone(filename string) {
+	j.append(journalRecord{Filename: filename, FileDone: true})
+}
+
+func (j *journal) append(r journalRecord) {
+	if j == nil {
+		return
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if err := j.enc.Encode(r); err != nil {
+		return //best effort: a lost checkpoint only costs replaying one extra page on resume
+	}
+
+	if j.pending++; j.pending >= journalBatchSize {
+		j.flush()
+	}
+}
+
+//flush fsyncs the pending batch of records by appending and syncing a valid marker.
+func (j *journal) flush() {
+	if _, err := j.f.WriteString("#valid\n"); err != nil {
+		return
+	}
+	j.f.Sync()
+	j.pending = 0
+}
+
+//Close flushes any pending records and closes the journal file. It is a no-op on a nil journal.
+func (j *journal) Close() error {
+	if j == nil {
+		return nil
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.pending > 0 {
+		j.flush()
+	}
+	return j.f.Close()
+}
+
+//loadJournal replays path, returning the set of dump files fully drained in a previous
+//run and, for every other file with at least one checkpoint, the page ID of the last
+//page fully drained before the process stopped.
+func loadJournal(path string) (completed map[string]bool, checkpoints map[string]uint32, err error) {
+	completed, checkpoints = map[string]bool{}, map[string]uint32{}
+
+	f, err := os.Open(path)
+	switch {
+	case os.IsNotExist(err):
+		return completed, checkpoints, nil
+	case err != nil:
+		return nil, nil, errorsOnSteroids.Wrapf(err, "Error while opening journal %q", path)
+	}
+	defer f.Close()
+
+	var batch []journalRecord
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1<<20)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "#valid" { //the preceding batch is durable: commit it
+			for _, r := range batch {
+				if r.FileDone {
+					completed[r.Filename] = true
+					delete(checkpoints, r.Filename)
+					continue
+				}
+				checkpoints[r.Filename] = r.PageID
+			}
+			batch = batch[:0]
+			continue
+		}
+
+		var r journalRecord
+		if err := json.Unmarshal([]byte(line), &r); err != nil {
+			break //torn write at EOF: stop, the unmarked tail is discarded
+		}
+		batch = append(batch, r)
+	}
+
+	return completed, checkpoints, nil
+}
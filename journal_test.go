@@ -0,0 +1,44 @@
+package wikibrief
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestJournalResume(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.journal")
+
+	j, err := newJournal(path)
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+
+	j.record("a.xml", 1, 10)
+	j.record("a.xml", 2, 20)
+	j.markFileDone("a.xml")
+	j.record("b.xml", 5, 50)
+	if err := j.Close(); err != nil {
+		t.Fatalf("%+v", err)
+	}
+
+	completed, checkpoints, err := loadJournal(path)
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+
+	if !completed["a.xml"] {
+		t.Error("Expecting a.xml to be marked as fully drained")
+	}
+	if _, ok := checkpoints["a.xml"]; ok {
+		t.Error("Expecting a.xml to have no dangling checkpoint once fully drained")
+	}
+	if pageID := checkpoints["b.xml"]; pageID != 5 {
+		t.Error("Expecting b.xml checkpoint at pageID 5, found", pageID)
+	}
+}
+
+func TestResetMissingJournal(t *testing.T) {
+	if err := Reset(t.TempDir(), "nonexistent-lang"); err != nil {
+		t.Errorf("Expecting Reset of a never-created journal to be a no-op, found %+v", err)
+	}
+}
@@ -0,0 +1,76 @@
+package wikibrief
+
+import (
+	"bufio"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+//resolveCacheOptions applies MemoryFraction, overriding MaxTotalBytes with that fraction
+//of systemMemory, and derives MaxPageBytes from MaxTotalBytes when opts leaves it unset,
+//so every caller needing the cache's effective budget shares the same fallback logic.
+func resolveCacheOptions(opts CacheOptions) CacheOptions {
+	if opts.MemoryFraction > 0 {
+		if mem := systemMemory(); mem > 0 {
+			opts.MaxTotalBytes = int64(opts.MemoryFraction * float64(mem))
+		}
+	}
+	if opts.MaxTotalBytes > 0 && opts.MaxPageBytes <= 0 {
+		opts.MaxPageBytes = opts.MaxTotalBytes / pageBufferSize
+	}
+	return opts
+}
+
+//bufferSizes returns the page and revision channel buffer sizes a single New call
+//should use, derived from opts, falling back to the historical fixed-size buffers
+//(pageBufferSize, revisionBufferSize) whenever opts leaves sizing unset.
+//There are 4 buffers in various forms: 4*pageBufferSize is the maximum number of
+//wikipedia pages in memory. Each page has a buffer of revisionBufferSize revisions:
+//this means that at each moment there is a maximum of
+//4*pageBufferSize*revisionBufferSize page texts in memory. With a budget set, only the
+//Text queued inside the Cache's spools counts against opts.MaxTotalBytes; revisions held
+//in the channel buffers themselves are not counted.
+func bufferSizes(opts CacheOptions) (pages, revisions int) {
+	opts = resolveCacheOptions(opts)
+	if opts.MaxTotalBytes <= 0 {
+		return pageBufferSize, revisionBufferSize
+	}
+
+	//Assume an average revision is a few KB of wikitext; size the per-page revision
+	//buffer so that a single page never reserves more than MaxPageBytes of in-flight text.
+	const assumedAverageRevisionBytes = 4 * 1024
+	if revisions = int(opts.MaxPageBytes / assumedAverageRevisionBytes); revisions < 1 {
+		revisions = 1
+	}
+
+	if pages = int(opts.MaxTotalBytes / opts.MaxPageBytes); pages < 1 {
+		pages = 1
+	}
+
+	return
+}
+
+//systemMemory returns the total system memory in bytes, read from /proc/meminfo on
+//Linux or, failing that, approximated from runtime.MemStats. It returns 0 if neither
+//source is available.
+func systemMemory() int64 {
+	if f, err := os.Open("/proc/meminfo"); err == nil {
+		defer f.Close()
+
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			fields := strings.Fields(scanner.Text())
+			if len(fields) >= 2 && fields[0] == "MemTotal:" {
+				if kB, err := strconv.ParseInt(fields[1], 10, 64); err == nil {
+					return kB * 1024
+				}
+			}
+		}
+	}
+
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	return int64(m.Sys)
+}
@@ -0,0 +1,37 @@
+package wikibrief
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"path/filepath"
+	"testing"
+)
+
+//minimalDump is just enough MediaWiki XML to drive a single page through SetPageID,
+//without ever matching a resumeState.target that isn't 1.
+const minimalDump = `<mediawiki><page><title>Go</title><id>1</id></page></mediawiki>`
+
+func TestRunFailsWhenResumeTargetNeverFound(t *testing.T) {
+	jr, err := newJournal(filepath.Join(t.TempDir(), "resume.journal"))
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	defer jr.Close()
+
+	rs := &resumeState{target: 99} //never matches the dump's only page, ID 1
+	ec := &errorContext{Filename: "minimalDump"}
+
+	base := bBase{xml.NewDecoder(bytes.NewBuffer([]byte(minimalDump))), nil, nil, nil, nil, revisionBufferSize, jr, rs, ec, SHA1Detector()}
+	err = run(context.Background(), base)
+
+	if err == nil {
+		t.Fatal("Expecting run to fail once EOF is reached without ever finding the resume checkpoint's target page")
+	}
+	if rootCause(err) != errResumeTargetNotFound {
+		t.Errorf("Expecting the error's root cause to be errResumeTargetNotFound, found %+v", rootCause(err))
+	}
+	if rs.done {
+		t.Error("Expecting rs.done to remain false, since the target page was never found")
+	}
+}
@@ -0,0 +1,294 @@
+package wikibrief
+
+import "strings"
+
+//RevertDetector decides, for one page's revisions observed in chronological order,
+//whether each one reverts an earlier revision of that same page. A RevertDetector is
+//stateful and scoped to a single page - see RevertDetectorFactory.
+type RevertDetector interface {
+	//Observe records rev as the next revision of the page and reports whether it is a
+	//revert and, if so, revertedCount: the number of revisions being undone, i.e. the
+	//number of revisions between it and the revision it restores.
+	Observe(rev Revision) (revertedCount uint32, isRevert bool)
+}
+
+//RevertDetectorFactory creates a fresh RevertDetector for each page digested, so
+//per-page state (a SHA1 history, a text-similarity index, ...) never leaks across
+//pages. New defaults to SHA1Detector() when WithRevertDetector is not used.
+type RevertDetectorFactory func() RevertDetector
+
+//WithRevertDetector selects the strategy New uses to flag reverted revisions; it
+//otherwise defaults to SHA1Detector(). Compose several strategies with ComposeRevertDetectors.
+func WithRevertDetector(factory RevertDetectorFactory) Option {
+	return func(o *options) { o.revertDetector = factory }
+}
+
+/////////////////////////////////////////////////////////////////////////////////////
+
+//sha1Detector is the original strategy: a revert is an exact SHA1 match against an
+//earlier revision of the page.
+type sha1Detector struct {
+	serial uint32
+	bySHA1 map[string]uint32
+}
+
+//SHA1Detector flags a revision as a revert when its SHA1 exactly matches an earlier
+//revision of the same page, keeping an unbounded per-page history of every SHA1 seen.
+func SHA1Detector() RevertDetectorFactory {
+	return func() RevertDetector { return &sha1Detector{bySHA1: map[string]uint32{}} }
+}
+
+func (d *sha1Detector) Observe(rev Revision) (revertedCount uint32, isRevert bool) {
+	serialID := d.serial
+	oldSerialID, isRevert := d.bySHA1[rev.SHA1]
+	switch {
+	case isRevert:
+		revertedCount = serialID - (oldSerialID + 1)
+		fallthrough
+	case len(rev.SHA1) == 31:
+		d.bySHA1[rev.SHA1] = serialID
+	}
+	d.serial++
+	return
+}
+
+/////////////////////////////////////////////////////////////////////////////////////
+
+//windowedSHA1Detector is sha1Detector bounded to the last window revisions, so pages
+//with a huge revision history don't grow an ever-larger bySHA1 map.
+type windowedSHA1Detector struct {
+	window  int
+	serial  uint32
+	bySHA1  map[string]uint32
+	ordered []sha1AtSerial //observation order, oldest first, to evict once over window
+}
+
+//sha1AtSerial pairs a SHA1 with the serial ID it was observed at, so windowedSHA1Detector
+//can tell, once it evicts the oldest observation of a SHA1, whether bySHA1 still points
+//at that very observation or was since overwritten by a more recent repeat.
+type sha1AtSerial struct {
+	sha1   string
+	serial uint32
+}
+
+//WindowedSHA1Detector is SHA1Detector bounded to the last window revisions: it misses
+//reverts further back than that, trading recall for a fixed memory footprint.
+func WindowedSHA1Detector(window int) RevertDetectorFactory {
+	return func() RevertDetector {
+		return &windowedSHA1Detector{window: window, bySHA1: map[string]uint32{}}
+	}
+}
+
+func (d *windowedSHA1Detector) Observe(rev Revision) (revertedCount uint32, isRevert bool) {
+	serialID := d.serial
+	oldSerialID, isRevert := d.bySHA1[rev.SHA1]
+	if isRevert {
+		revertedCount = serialID - (oldSerialID + 1)
+	}
+	if len(rev.SHA1) == 31 {
+		d.bySHA1[rev.SHA1] = serialID
+		d.ordered = append(d.ordered, sha1AtSerial{rev.SHA1, serialID})
+	}
+
+	for len(d.ordered) > d.window {
+		evicted := d.ordered[0]
+		d.ordered = d.ordered[1:]
+		if d.bySHA1[evicted.sha1] == evicted.serial { //still the observation we evicted, not a fresher repeat
+			delete(d.bySHA1, evicted.sha1)
+		}
+	}
+
+	d.serial++
+	return
+}
+
+/////////////////////////////////////////////////////////////////////////////////////
+
+//revertTags are the MediaWiki edit tags applied by the software itself when an edit
+//restores a page to an earlier state - see https://www.mediawiki.org/wiki/Manual:Tags.
+var revertTags = map[string]bool{
+	"mw-rollback":      true,
+	"mw-undo":          true,
+	"mw-manual-revert": true,
+}
+
+//tagDetector layers MediaWiki's own revert tags over sha1Detector, catching partial
+//reverts and rollbacks the software tagged but whose SHA1 doesn't exactly match any
+//earlier revision (e.g. a revert rebased over a trivial intervening edit).
+type tagDetector struct {
+	sha1Detector
+}
+
+//TagDetector flags a revision as a revert whenever MediaWiki tagged it with a rollback,
+//undo or manual-revert tag, falling back to SHA1Detector's exact-match detection (and
+//its revertedCount) when no such tag is present. When a tag fires without a matching
+//SHA1, revertedCount is reported as 0: the tag confirms a revert happened but not how
+//far back it reaches.
+func TagDetector() RevertDetectorFactory {
+	return func() RevertDetector { return &tagDetector{sha1Detector{bySHA1: map[string]uint32{}}} }
+}
+
+func (d *tagDetector) Observe(rev Revision) (revertedCount uint32, isRevert bool) {
+	revertedCount, isRevert = d.sha1Detector.Observe(rev)
+	if isRevert {
+		return
+	}
+
+	for _, tag := range rev.Tags {
+		if revertTags[tag] {
+			return 0, true
+		}
+	}
+	return
+}
+
+/////////////////////////////////////////////////////////////////////////////////////
+
+//textSnapshot is a past revision's MinHash signature, kept just long enough to compare
+//against incoming revisions within shingledTextDetector's window.
+type textSnapshot struct {
+	serial uint32
+	sig    []uint64
+}
+
+//shingledTextDetector flags near-reverts - edits that restore most, but not all, of an
+//earlier revision's text - by estimating the Jaccard similarity of word shingles via
+//MinHash, rather than requiring an exact SHA1 match.
+type shingledTextDetector struct {
+	window      int
+	shingleSize int
+	hashCount   int
+	threshold   float64
+
+	serial  uint32
+	history []textSnapshot
+}
+
+//ShingledTextDetector flags a revision as a (near-)revert when its text's MinHash
+//signature is at least threshold similar, by estimated Jaccard similarity over
+//shingleSize-word shingles, to one of the last window revisions of the page.
+func ShingledTextDetector(window, shingleSize int, threshold float64) RevertDetectorFactory {
+	return func() RevertDetector {
+		return &shingledTextDetector{window: window, shingleSize: shingleSize, hashCount: 24, threshold: threshold}
+	}
+}
+
+func (d *shingledTextDetector) Observe(rev Revision) (revertedCount uint32, isRevert bool) {
+	sig := minhashSignature(rev.Text, d.shingleSize, d.hashCount)
+
+	var bestSerial uint32
+	var bestSimilarity float64
+	for _, snap := range d.history {
+		if similarity := jaccardEstimate(sig, snap.sig); similarity > bestSimilarity {
+			bestSimilarity, bestSerial = similarity, snap.serial
+		}
+	}
+	if len(d.history) > 0 && bestSimilarity >= d.threshold {
+		isRevert, revertedCount = true, d.serial-(bestSerial+1)
+	}
+
+	d.history = append(d.history, textSnapshot{d.serial, sig})
+	if len(d.history) > d.window {
+		d.history = d.history[1:]
+	}
+	d.serial++
+
+	return
+}
+
+//shingles splits text into its sliding-window word shingles of size k.
+func shingles(text string, k int) []string {
+	words := strings.Fields(text)
+	if len(words) < k {
+		if len(words) == 0 {
+			return nil
+		}
+		return []string{strings.Join(words, " ")}
+	}
+
+	shingles := make([]string, 0, len(words)-k+1)
+	for i := 0; i+k <= len(words); i++ {
+		shingles = append(shingles, strings.Join(words[i:i+k], " "))
+	}
+	return shingles
+}
+
+//minhashSignature computes a hashCount-wide MinHash signature of text's k-word
+//shingles: fnv1a(shingle) salted hashCount times stands in for hashCount independent
+//hash functions, cheaply enough to run on the decoder hot path.
+func minhashSignature(text string, k, hashCount int) []uint64 {
+	sig := make([]uint64, hashCount)
+	for i := range sig {
+		sig[i] = ^uint64(0)
+	}
+
+	for _, shingle := range shingles(text, k) {
+		base := fnv1a(shingle)
+		for i := 0; i < hashCount; i++ {
+			if h := base ^ (uint64(i+1) * 0x9E3779B97F4A7C15); h < sig[i] {
+				sig[i] = h
+			}
+		}
+	}
+
+	return sig
+}
+
+//jaccardEstimate approximates the Jaccard similarity of the two shingle sets a and b
+//were computed from, as the fraction of MinHash slots that agree.
+func jaccardEstimate(a, b []uint64) float64 {
+	if len(a) == 0 || len(a) != len(b) {
+		return 0
+	}
+
+	agree := 0
+	for i := range a {
+		if a[i] == b[i] {
+			agree++
+		}
+	}
+	return float64(agree) / float64(len(a))
+}
+
+func fnv1a(s string) uint64 {
+	const offset64, prime64 = 14695981039346656037, 1099511628211
+	h := uint64(offset64)
+	for i := 0; i < len(s); i++ {
+		h ^= uint64(s[i])
+		h *= prime64
+	}
+	return h
+}
+
+/////////////////////////////////////////////////////////////////////////////////////
+
+//compositeRevertDetector runs every detector on each revision so their state all stays
+//current, and reports a revert if any of them does - see ComposeRevertDetectors.
+type compositeRevertDetector struct {
+	detectors []RevertDetector
+}
+
+//ComposeRevertDetectors combines several strategies into one: a revision is a revert if
+//any of factories' detectors says so, and revertedCount is the largest one reported by
+//those that agreed.
+func ComposeRevertDetectors(factories ...RevertDetectorFactory) RevertDetectorFactory {
+	return func() RevertDetector {
+		detectors := make([]RevertDetector, len(factories))
+		for i, factory := range factories {
+			detectors[i] = factory()
+		}
+		return &compositeRevertDetector{detectors}
+	}
+}
+
+func (c *compositeRevertDetector) Observe(rev Revision) (revertedCount uint32, isRevert bool) {
+	for _, d := range c.detectors {
+		if count, ok := d.Observe(rev); ok {
+			isRevert = true
+			if count > revertedCount {
+				revertedCount = count
+			}
+		}
+	}
+	return
+}
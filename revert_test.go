@@ -0,0 +1,105 @@
+package wikibrief
+
+import (
+	"strings"
+	"testing"
+)
+
+func sha1Of(c string) string { return strings.Repeat(c, 31) } //a valid-looking 31-char sha1
+
+func TestSHA1Detector(t *testing.T) {
+	d := SHA1Detector()()
+
+	shaA, shaB, shaC := sha1Of("a"), sha1Of("b"), sha1Of("c")
+	seq := []struct {
+		sha1       string
+		wantRevert bool
+		wantCount  uint32
+	}{
+		{shaA, false, 0},
+		{shaB, false, 0},
+		{shaC, false, 0},
+		{shaA, true, 2}, //reverts back to the 1st revision, undoing the b and c edits
+	}
+
+	for i, c := range seq {
+		count, isRevert := d.Observe(Revision{SHA1: c.sha1})
+		if isRevert != c.wantRevert || count != c.wantCount {
+			t.Errorf("revision %d: expected (revert=%v, count=%d), found (revert=%v, count=%d)", i, c.wantRevert, c.wantCount, isRevert, count)
+		}
+	}
+}
+
+func TestWindowedSHA1DetectorMissesBeyondWindow(t *testing.T) {
+	d := WindowedSHA1Detector(2)()
+
+	for _, sha1 := range []string{sha1Of("a"), sha1Of("b"), sha1Of("c")} {
+		d.Observe(Revision{SHA1: sha1})
+	}
+
+	//shaA's only observation was evicted from the 2-revision window by b and c, so it must be missed
+	if _, isRevert := d.Observe(Revision{SHA1: sha1Of("a")}); isRevert {
+		t.Error("Expecting a SHA1 match older than the window to be missed")
+	}
+}
+
+func TestWindowedSHA1DetectorCatchesWithinWindow(t *testing.T) {
+	d := WindowedSHA1Detector(2)()
+
+	d.Observe(Revision{SHA1: sha1Of("a")})
+	d.Observe(Revision{SHA1: sha1Of("b")})
+	if _, isRevert := d.Observe(Revision{SHA1: sha1Of("b")}); !isRevert {
+		t.Error("Expecting a SHA1 repeat within the window to be caught")
+	}
+}
+
+func TestTagDetector(t *testing.T) {
+	d := TagDetector()()
+
+	//no SHA1 match and no revert tag: not a revert
+	if _, isRevert := d.Observe(Revision{SHA1: sha1Of("a"), Tags: []string{"wikieditor"}}); isRevert {
+		t.Error("Expecting an untagged, non-matching revision not to be flagged as a revert")
+	}
+
+	//mw-rollback fires even without a matching SHA1, with an unknown revertedCount
+	count, isRevert := d.Observe(Revision{SHA1: sha1Of("b"), Tags: []string{"mw-rollback"}})
+	if !isRevert || count != 0 {
+		t.Errorf("Expecting a rollback tag to be flagged as a revert with an unknown count, found (revert=%v, count=%d)", isRevert, count)
+	}
+
+	//an exact SHA1 match still reports its precise revertedCount, tag or no tag
+	count, isRevert = d.Observe(Revision{SHA1: sha1Of("a")})
+	if !isRevert || count != 1 {
+		t.Errorf("Expecting the exact SHA1 match to report its own revertedCount, found (revert=%v, count=%d)", isRevert, count)
+	}
+}
+
+func TestShingledTextDetector(t *testing.T) {
+	d := ShingledTextDetector(4, 3, 0.9)()
+
+	original := "the quick brown fox jumps over the lazy dog every single morning without fail"
+	unrelated := "completely different content about something else entirely and not alike at all"
+
+	d.Observe(Revision{Text: original})
+	if _, isRevert := d.Observe(Revision{Text: unrelated}); isRevert {
+		t.Error("Expecting unrelated text not to be flagged as a near-revert")
+	}
+	if _, isRevert := d.Observe(Revision{Text: original}); !isRevert {
+		t.Error("Expecting a near-exact repeat of earlier text to be flagged as a near-revert")
+	}
+}
+
+func TestComposeRevertDetectors(t *testing.T) {
+	d := ComposeRevertDetectors(SHA1Detector(), TagDetector())()
+
+	d.Observe(Revision{SHA1: sha1Of("a")})
+	if _, isRevert := d.Observe(Revision{SHA1: sha1Of("b"), Tags: []string{"mw-undo"}}); !isRevert {
+		t.Error("Expecting the tag-triggered detector's verdict to carry through ComposeRevertDetectors")
+	}
+
+	//every composed detector must still observe every revision, or their own state would desync
+	count, isRevert := d.Observe(Revision{SHA1: sha1Of("a")})
+	if !isRevert || count != 1 {
+		t.Errorf("Expecting the SHA1 detector embedded in TagDetector to still track state across calls, found (revert=%v, count=%d)", isRevert, count)
+	}
+}
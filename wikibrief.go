@@ -15,48 +15,125 @@ import (
 
 	"github.com/negapedia/wikiassignment"
 	"github.com/negapedia/wikibots"
-	"github.com/negapedia/wikidump"
 	"github.com/negapedia/wikipage"
 
 	errorsOnSteroids "github.com/pkg/errors"
 )
 
+//Option configures optional behaviour of New.
+type Option func(*options)
+
+type options struct {
+	cache          CacheOptions
+	resume         ResumeOptions
+	dumpSource     DumpSource
+	onFileError    func(Error) Action
+	revertDetector RevertDetectorFactory
+}
+
+//WithCache bounds the memory New uses to buffer revision Text payloads, spilling the
+//coldest ones to tmpDir once the budget in opts is exceeded, and derives New's page
+//and revision channel buffer sizes from that same budget. See CacheOptions.
+func WithCache(opts CacheOptions) Option {
+	return func(o *options) { o.cache = opts }
+}
+
+//WithResume applies opts, letting New resume a previously interrupted digest from its
+//on-disk journal instead of restarting from scratch. See ResumeOptions.
+func WithResume(opts ResumeOptions) Option {
+	return func(o *options) { o.resume = opts }
+}
+
+//WithDumpSource overrides where New reads lang's dump files from; it otherwise defaults
+//to LatestDump(tmpDir, lang). See DumpSource.
+func WithDumpSource(src DumpSource) Option {
+	return func(o *options) { o.dumpSource = src }
+}
+
+//WithOnFileError installs a policy deciding how New reacts once a dump file fails to
+//digest: Abort (the default when no policy is set) stops the whole digest and reports
+//the Error through fail, Skip discards the offending file and moves on to the next one,
+//Retry re-attempts it. See Error and Action.
+func WithOnFileError(f func(Error) Action) Option {
+	return func(o *options) { o.onFileError = f }
+}
+
 //New digest the latest wikipedia dump of the specified language into the output channel.
 //The revision channel of each page must be exhausted (or the context cancelled), doing otherwise may result in a deadlock.
 //The ctx and fail together should behave in the same manner as if created with WithFail - https://godoc.org/github.com/ebonetti/ctxutils#WithFail
 //The condition restrict restricts the digest to just one dump file, used for testing purposes.
-func New(ctx context.Context, fail func(err error) error, tmpDir, lang string, restrict bool) <-chan EvolvingPage {
+//The returned Cache tracks the digest's in-flight memory usage and can be inspected via Cache.Stats; it must be closed once pages has been fully drained.
+//WithDumpSource replaces the latest dump with any other DumpSource.
+func New(ctx context.Context, fail func(err error) error, tmpDir, lang string, restrict bool, opts ...Option) (pages <-chan EvolvingPage, cache *Cache) {
 	//Default value to a closed channel
 	dummyPagesChan := make(chan EvolvingPage)
 	close(dummyPagesChan)
 
-	ID2Bot, err := wikibots.New(ctx, lang)
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+	pageBufSz, revisionBufSz := bufferSizes(o.cache)
+
+	cache, err := newCache(tmpDir, o.cache)
 	if err != nil {
 		fail(err)
-		return dummyPagesChan
+		return dummyPagesChan, nil
 	}
 
-	latestDump, err := wikidump.Latest(tmpDir, lang, "metahistory7zdump",
-		"pagetable", "redirecttable", "categorylinkstable", "pagelinkstable")
+	ID2Bot, err := wikibots.New(ctx, lang)
 	if err != nil {
 		fail(err)
-		return dummyPagesChan
+		return dummyPagesChan, cache
+	}
+
+	source := o.dumpSource
+	if source == nil {
+		if source, err = LatestDump(tmpDir, lang); err != nil {
+			fail(err)
+			return dummyPagesChan, cache
+		}
 	}
 
 	article2TopicID, err := getArticle2TopicID(ctx, tmpDir, lang)
 	if err != nil {
 		fail(err)
-		return dummyPagesChan
+		return dummyPagesChan, cache
+	}
+
+	journalPath := o.resume.JournalPath
+	if journalPath == "" {
+		journalPath = defaultJournalPath(tmpDir, lang)
+	}
+
+	completedFiles, checkpoints := map[string]bool{}, map[string]uint32{}
+	if o.resume.Resume {
+		if completedFiles, checkpoints, err = loadJournal(journalPath); err != nil {
+			fail(err)
+			return dummyPagesChan, cache
+		}
+	}
+
+	jr, err := newJournal(journalPath)
+	if err != nil {
+		fail(err)
+		return dummyPagesChan, cache
+	}
+
+	revertDetector := o.revertDetector
+	if revertDetector == nil {
+		revertDetector = SHA1Detector()
 	}
 
-	simplePages := make(chan EvolvingPage, pageBufferSize)
+	simplePages := make(chan EvolvingPage, pageBufSz)
 	go func() {
 		defer close(simplePages)
+		defer jr.Close()
 
 		//limit the number of workers to prevent system from killing 7zip instances
-		wg := sizedwaitgroup.New(pageBufferSize)
+		wg := sizedwaitgroup.New(pageBufSz)
 
-		it := latestDump.Open("metahistory7zdump")
+		it := source.Iter(ctx)
 		r, err := it(ctx)
 		if restrict { //Use just one dump file for testing purposes
 			it = func(_ context.Context) (io.ReadCloser, error) {
@@ -64,19 +141,49 @@ func New(ctx context.Context, fail func(err error) error, tmpDir, lang string, r
 			}
 		}
 		for ; err == nil; r, err = it(ctx) {
+			fn := filename(r)
+			if completedFiles[fn] { //Already fully drained in a previous run, skip entirely
+				r.Close()
+				continue
+			}
+
 			if err = wg.AddWithContext(ctx); err != nil { //AddWithContext fails only if ctx is Done
 				r.Close()
 				break
 			}
 
-			go func(r io.ReadCloser) {
+			var rs *resumeState
+			if pageID, ok := checkpoints[fn]; ok {
+				rs = &resumeState{target: pageID}
+			}
+
+			go func(r io.ReadCloser, rs *resumeState, fn string) {
 				defer wg.Done()
 				defer r.Close()
-				err := run(ctx, bBase{xml.NewDecoder(r), article2TopicID, ID2Bot, simplePages, &errorContext{"", filename(r)}})
-				if err != nil {
-					fail(err)
+
+				ec := &errorContext{Filename: fn}
+				for {
+					err := run(ctx, bBase{xml.NewDecoder(r), article2TopicID, ID2Bot, simplePages, cache, revisionBufSz, jr, rs, ec, revertDetector})
+					if err == nil {
+						return
+					}
+
+					fe := classify(err, lang, fn, ec)
+					action := Abort
+					if o.onFileError != nil {
+						action = o.onFileError(fe)
+					}
+					switch action {
+					case Skip:
+						return
+					case Retry: //best effort: resumes decoding wherever r's stream currently stands, not from the file's start
+						continue
+					default:
+						fail(fe)
+						return
+					}
 				}
-			}(r)
+			}(r, rs, fn)
 		}
 		if err != io.EOF {
 			fail(err)
@@ -84,7 +191,7 @@ func New(ctx context.Context, fail func(err error) error, tmpDir, lang string, r
 		wg.Wait()
 	}()
 
-	return completeInfo(ctx, fail, lang, simplePages)
+	return completeInfo(ctx, fail, lang, pageBufSz, simplePages), cache
 }
 
 //EvolvingPage represents a wikipedia page that is being edited. Revisions is closed when there are no more revisions.
@@ -103,6 +210,7 @@ type Revision struct {
 	Text, SHA1 string
 	IsRevert   uint32
 	Timestamp  time.Time
+	Tags       []string
 }
 
 //There are 4 buffers in various forms: 4*pageBufferSize is the maximum number of wikipedia pages in memory.
@@ -132,7 +240,13 @@ func run(ctx context.Context, base bBase) (err error) {
 		case "revision start":
 			b, err = b.NewRevision(ctx, t.(xml.StartElement))
 		case "page end":
-			b, err = b.ClosePage()
+			var pageID uint32
+			if bs, ok := b.(*bSetted); ok { //Only bSetted pages were actually emitted downstream
+				pageID = bs.PageID
+			}
+			if b, err = b.ClosePage(); err == nil {
+				base.Journal.record(base.ErrorContext.Filename, pageID, base.Decoder.InputOffset())
+			}
 		}
 		if err != nil {
 			break
@@ -149,6 +263,18 @@ func run(ctx context.Context, base bBase) (err error) {
 		err = b.Wrapf(err, "Unexpected error in outer XML Decoder event loop")
 	}
 
+	//A resume whose checkpointed target page is never encountered (a corrupted or
+	//truncated journal, a changed upstream dump, ...) must not be allowed to silently
+	//fast-forward through the entire rest of the file - surface it like any other
+	//per-file failure instead of quietly dropping the file's data.
+	if err == nil && base.Resume != nil && !base.Resume.done {
+		err = b.Wrapf(errResumeTargetNotFound, "Error while resuming %q: checkpointed page %v never found before EOF", base.ErrorContext.Filename, base.Resume.target)
+	}
+
+	if err == nil {
+		base.Journal.markFileDone(base.ErrorContext.Filename)
+	}
+
 	return
 }
 
@@ -157,6 +283,10 @@ const AnonimousUserID uint32 = 0
 
 var errInvalidXML = errors.New("Invalid XML")
 
+//errResumeTargetNotFound marks a resumed file whose checkpointed target page was never
+//encountered before EOF - see bTitled.SetPageID's fast-forward branch and run above.
+var errResumeTargetNotFound = errors.New("Resume checkpoint target page not found before EOF")
+
 type builder interface {
 	NewPage() (be builder, err error)
 	SetPageTitle(ctx context.Context, t xml.StartElement) (be builder, err error)
@@ -171,13 +301,19 @@ type builder interface {
 //bBase is the base state builder
 
 type bBase struct {
-	Decoder         *xml.Decoder
-	Article2TopicID func(articleID uint32) (topicID uint32, ok bool)
-	ID2Bot          func(userID uint32) (username string, ok bool)
-	OutStream       chan<- EvolvingPage
-	ErrorContext    *errorContext
+	Decoder            *xml.Decoder
+	Article2TopicID    func(articleID uint32) (topicID uint32, ok bool)
+	ID2Bot             func(userID uint32) (username string, ok bool)
+	OutStream          chan<- EvolvingPage
+	Cache              *Cache
+	RevisionBufferSize int
+	Journal            *journal
+	Resume             *resumeState
+	ErrorContext       *errorContext
+	NewRevertDetector  RevertDetectorFactory
 }
 
+
 func (bs *bBase) New() builder {
 	be := bBase(*bs)
 	return &be
@@ -276,18 +412,32 @@ func (bs *bTitled) SetPageID(ctx context.Context, t xml.StartElement) (be builde
 		err = bs.Wrapf(err, "Error while decoding page ID")
 		return
 	}
+	bs.ErrorContext.PageID = pageID //used for error reporting purposes
+
+	if rs := bs.Resume; rs != nil && !rs.done { //Fast-forward: skip pages already checkpointed by a previous run
+		if pageID == rs.target {
+			rs.done = true
+		}
+		if err = bs.Decoder.Skip(); err != nil {
+			err = bs.Wrapf(err, "Error while skipping page %v during resume fast-forward", pageID)
+			return
+		}
+		be = bs.New()
+		return
+	}
 
 	if topicID, ok := bs.Article2TopicID(pageID); ok {
-		revisions := make(chan Revision, revisionBufferSize)
+		revisions := make(chan Revision, bs.RevisionBufferSize)
 		select {
 		case <-ctx.Done():
 			err = bs.Wrapf(ctx.Err(), "Context cancelled")
 			return
-		case bs.OutStream <- EvolvingPage{pageID, bs.Title, "", topicID, revisions}: //Use empty abstract, later filled by completeInfo
+		case bs.OutStream <- EvolvingPage{pageID, bs.Title, "", topicID, bs.Cache.spool(ctx, revisions)}: //Use empty abstract, later filled by completeInfo
 			be = &bSetted{
-				bTitled:       *bs,
-				Revisions:     revisions,
-				SHA12SerialID: map[string]uint32{},
+				bTitled:   *bs,
+				Revisions: revisions,
+				PageID:    pageID,
+				Detector:  bs.NewRevertDetector(),
 			}
 			return
 		}
@@ -320,8 +470,9 @@ type bSetted struct {
 	bTitled
 
 	Revisions     chan Revision
+	PageID        uint32
 	RevisionCount uint32
-	SHA12SerialID map[string]uint32
+	Detector      RevertDetector
 }
 
 func (bs *bSetted) NewPage() (be builder, err error) { //no page nesting
@@ -348,17 +499,6 @@ func (bs *bSetted) NewRevision(ctx context.Context, t xml.StartElement) (be buil
 		return
 	}
 
-	//Calculate reverts
-	serialID, IsRevert := bs.RevisionCount, uint32(0)
-	oldSerialID, isRevert := bs.SHA12SerialID[r.SHA1]
-	switch {
-	case isRevert:
-		IsRevert = serialID - (oldSerialID + 1)
-		fallthrough
-	case len(r.SHA1) == 31:
-		bs.SHA12SerialID[r.SHA1] = serialID
-	}
-
 	//convert time
 	const layout = "2006-01-02T15:04:05Z"
 	timestamp, err := time.Parse(layout, r.Timestamp)
@@ -366,17 +506,21 @@ func (bs *bSetted) NewRevision(ctx context.Context, t xml.StartElement) (be buil
 		err = bs.Wrapf(err, "Error while decoding the timestamp %s of %vth revision", r.Timestamp, bs.RevisionCount+1)
 		return
 	}
-	r.Timestamp = ""
 
 	//Check if userID represents bot
 	_, isBot := bs.ID2Bot(r.UserID)
 
+	rev := Revision{r.ID, r.UserID, isBot, r.Text, r.SHA1, 0, timestamp, r.Tags}
+	if revertedCount, isRevert := bs.Detector.Observe(rev); isRevert {
+		rev.IsRevert = revertedCount
+	}
+
 	bs.RevisionCount++
 
 	select {
 	case <-ctx.Done():
 		err = bs.Wrapf(ctx.Err(), "Context cancelled")
-	case bs.Revisions <- Revision{r.ID, r.UserID, isBot, r.Text, r.SHA1, IsRevert, timestamp}:
+	case bs.Revisions <- rev:
 		be = bs
 	}
 
@@ -390,11 +534,12 @@ func (bs *bSetted) ClosePage() (be builder, err error) {
 
 // A page revision.
 type revision struct {
-	ID        uint32 `xml:"id"`
-	Timestamp string `xml:"timestamp"`
-	UserID    uint32 `xml:"contributor>id"`
-	Text      string `xml:"text"`
-	SHA1      string `xml:"sha1"`
+	ID        uint32   `xml:"id"`
+	Timestamp string   `xml:"timestamp"`
+	UserID    uint32   `xml:"contributor>id"`
+	Text      string   `xml:"text"`
+	SHA1      string   `xml:"sha1"`
+	Tags      []string `xml:"tags>tag"`
 	//converted data
 	timestamp time.Time
 }
@@ -412,11 +557,12 @@ func xmlEvent(t xml.Token) string {
 
 type errorContext struct {
 	LastTitle string //used for error reporting purposes
+	PageID    uint32 //used for error reporting purposes
 	Filename  string //used for error reporting purposes
 }
 
 func (ec errorContext) String() string {
-	report := fmt.Sprintf("last title %v in \"%s\"", ec.LastTitle, ec.Filename)
+	report := fmt.Sprintf("last title %v (page %v) in \"%s\"", ec.LastTitle, ec.PageID, ec.Filename)
 	if _, err := os.Stat(ec.Filename); os.IsNotExist(err) {
 		report += " - WARNING: file not found!"
 	}
@@ -450,13 +596,13 @@ func getArticle2TopicID(ctx context.Context, tmpDir, lang string) (article2Topic
 	}, nil
 }
 
-func completeInfo(ctx context.Context, fail func(err error) error, lang string, pages <-chan EvolvingPage) <-chan EvolvingPage {
-	results := make(chan EvolvingPage, pageBufferSize)
+func completeInfo(ctx context.Context, fail func(err error) error, lang string, pageBufSz int, pages <-chan EvolvingPage) <-chan EvolvingPage {
+	results := make(chan EvolvingPage, pageBufSz)
 	go func() {
 		defer close(results)
 		wikiPage := wikipage.New(lang)
 		wg := sync.WaitGroup{}
-		for i := 0; i < pageBufferSize; i++ {
+		for i := 0; i < pageBufSz; i++ {
 			wg.Add(1)
 			go func() {
 				defer wg.Done()
@@ -17,7 +17,8 @@ import (
 
 func TestUnit(t *testing.T) {
 	ctx, fail := ctxutils.WithFail(context.Background())
-	pages := New(ctx, fail, "/tmp", "zu", true)
+	pages, cache := New(ctx, fail, "/tmp", "zu", true)
+	defer cache.Close()
 	wg := sync.WaitGroup{}
 	for i := 0; i < 200; i++ {
 		wg.Add(1)
@@ -52,7 +53,7 @@ func TestRun(t *testing.T) {
 	ch := make(chan simpleEvolvingPage)
 	go func() {
 		defer close(ch)
-		err := run(ctx, bBase{xml.NewDecoder(bytes.NewBuffer(b)), func(uint32) (uint32, bool) { return 0, true }, ID2Bot, ch, &errorContext{0, "holyGrail"}})
+		err := run(ctx, bBase{xml.NewDecoder(bytes.NewBuffer(b)), func(uint32) (uint32, bool) { return 0, true }, ID2Bot, ch, nil, revisionBufferSize, nil, nil, &errorContext{0, "holyGrail"}, SHA1Detector()})
 		if err != nil {
 			t.Fatalf("%+v", err)
 		}